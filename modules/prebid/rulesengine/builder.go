@@ -0,0 +1,204 @@
+package rulesengine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"jackfan.us.kg/lephones/prebid-server/rules"
+)
+
+// config is the account-level rules config document handed to
+// NewCacheObject, e.g. as read from PBS's account config source.
+type config struct {
+	cfg json.RawMessage
+}
+
+// configDoc is the JSON shape of config.cfg.
+type configDoc struct {
+	RuleSets []ruleSetDoc `json:"ruleSets"`
+}
+
+type ruleSetDoc struct {
+	Stage       string          `json:"stage"`
+	Name        string          `json:"name"`
+	ModelGroups []modelGroupDoc `json:"modelGroups"`
+}
+
+type modelGroupDoc struct {
+	Weight       int       `json:"weight"`
+	Version      string    `json:"version"`
+	AnalyticsKey string    `json:"analyticsKey"`
+	Defaults     []funcDoc `json:"defaults"`
+	Tree         nodeDoc   `json:"tree"`
+}
+
+// funcDoc is the JSON shape of a single schema/result function reference:
+// its registered name (versioned names like "deviceCountry@v2" are just
+// part of the string) and its raw args.
+type funcDoc struct {
+	Func string          `json:"func"`
+	Args json.RawMessage `json:"args"`
+}
+
+// nodeDoc is the JSON shape of a single rules.Node: its schema function (nil
+// on a leaf), its result functions (usually only set on a leaf or dead end),
+// and its children keyed by the schema function's result value.
+type nodeDoc struct {
+	SchemaFunc  *funcDoc           `json:"schemaFunc,omitempty"`
+	ResultFuncs []funcDoc          `json:"resultFuncs,omitempty"`
+	Children    map[string]nodeDoc `json:"children,omitempty"`
+}
+
+// buildNode recursively compiles doc into a rules.Node via reg, deduping
+// identical subtrees through cache: doc's hash is computed and cache.Get is
+// checked before anything under it is compiled, so a subtree appearing
+// under multiple model groups (or unchanged across a refresh once grafted
+// in via cache.PutIfAbsent) is only ever compiled once.
+//
+// The dedup key is docHash(doc), not the compiled node's rules.Node.Hash():
+// rules.Node.Hash only has the constructed SchemaFunction/ResultFunction
+// values to work with, and falls back to just their registered name when
+// they don't implement an optional Spec() method — which none of
+// DefaultRegistry's constructors do. docHash instead hashes straight off
+// doc, which still has each function's raw Args JSON, so an edit to only a
+// leaf's args (a floor threshold, a country list) changes the hash instead
+// of being silently treated as "unchanged".
+func buildNode(doc nodeDoc, reg *rules.Registry[Payload, Result], cache *rules.HashCache[Payload, Result]) (*rules.Node[Payload, Result], error) {
+	h := docHash(doc)
+	if existing, ok := cache.Get(h); ok {
+		return existing, nil
+	}
+
+	node := &rules.Node[Payload, Result]{}
+
+	if doc.SchemaFunc != nil {
+		fn, err := reg.NewSchemaFunction(doc.SchemaFunc.Func, doc.SchemaFunc.Args)
+		if err != nil {
+			return nil, err
+		}
+		node.SchemaFunction = fn
+	}
+
+	for _, rf := range doc.ResultFuncs {
+		fn, err := reg.NewResultFunction(rf.Func, rf.Args)
+		if err != nil {
+			return nil, err
+		}
+		node.ResultFunctions = append(node.ResultFunctions, fn)
+	}
+
+	if len(doc.Children) > 0 {
+		node.Children = make(map[string]*rules.Node[Payload, Result], len(doc.Children))
+		for value, childDoc := range doc.Children {
+			child, err := buildNode(childDoc, reg, cache)
+			if err != nil {
+				return nil, err
+			}
+			node.Children[value] = child
+		}
+	}
+
+	return cache.PutIfAbsent(h, node), nil
+}
+
+// docHash computes doc's content hash bottom-up, mirroring rules.Node.Hash's
+// shape (sorted children, declared-order result functions) but hashing
+// straight off each funcDoc's Func name and raw Args bytes, which survive in
+// doc long after buildNode has thrown away the parsed function values.
+func docHash(doc nodeDoc) rules.Hash {
+	type childEntry struct {
+		Value string     `json:"value"`
+		Hash  rules.Hash `json:"hash"`
+	}
+
+	entries := make([]childEntry, 0, len(doc.Children))
+	for value, child := range doc.Children {
+		entries = append(entries, childEntry{Value: value, Hash: docHash(child)})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Value < entries[j].Value })
+
+	resultFuncs := make([]funcDoc, len(doc.ResultFuncs))
+	copy(resultFuncs, doc.ResultFuncs)
+
+	payload := struct {
+		SchemaFunc  *funcDoc     `json:"schemaFunc,omitempty"`
+		ResultFuncs []funcDoc    `json:"resultFuncs,omitempty"`
+		Children    []childEntry `json:"children,omitempty"`
+	}{
+		SchemaFunc:  doc.SchemaFunc,
+		ResultFuncs: resultFuncs,
+		Children:    entries,
+	}
+
+	b, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(b)
+	return rules.Hash(hex.EncodeToString(sum[:]))
+}
+
+// buildDefaults compiles a model group's default result functions, run when
+// the walk never reaches a leaf with its own.
+func buildDefaults(docs []funcDoc, reg *rules.Registry[Payload, Result]) ([]Function, error) {
+	defaults := make([]Function, 0, len(docs))
+	for _, d := range docs {
+		fn, err := reg.NewResultFunction(d.Func, d.Args)
+		if err != nil {
+			return nil, err
+		}
+		defaults = append(defaults, fn)
+	}
+	return defaults, nil
+}
+
+// NewCacheObject parses cfg and compiles every ruleset/model group it
+// declares, using DefaultRegistry to resolve schema/result function names
+// and treeHashCache to dedup identical subtrees. Each model group's root
+// content hash (docHash of its tree) is recorded alongside it and folded
+// into the object's ruleset root hash; refreshCacheObject does not compare
+// these hashes itself, since unchanged subtrees are reused via
+// treeHashCache.
+func NewCacheObject(cfg config) (cacheObject, error) {
+	var doc configDoc
+	if len(cfg.cfg) > 0 {
+		if err := json.Unmarshal(cfg.cfg, &doc); err != nil {
+			return cacheObject{}, fmt.Errorf("rulesengine: parsing config: %w", err)
+		}
+	}
+
+	obj := cacheObject{cfg: cfg.cfg}
+
+	for _, rs := range doc.RuleSets {
+		ruleSet := cacheRuleSet{stage: rs.Stage, name: rs.Name}
+
+		for _, mg := range rs.ModelGroups {
+			root, err := buildNode(mg.Tree, DefaultRegistry, treeHashCache)
+			if err != nil {
+				return cacheObject{}, fmt.Errorf("rulesengine: building %s/%s/%s: %w", rs.Stage, rs.Name, mg.Version, err)
+			}
+
+			defaults, err := buildDefaults(mg.Defaults, DefaultRegistry)
+			if err != nil {
+				return cacheObject{}, fmt.Errorf("rulesengine: building defaults for %s/%s/%s: %w", rs.Stage, rs.Name, mg.Version, err)
+			}
+
+			ruleSet.modelGroups = append(ruleSet.modelGroups, cacheModelGroup{
+				weight:       mg.Weight,
+				version:      mg.Version,
+				analyticsKey: mg.AnalyticsKey,
+				defaults:     defaults,
+				root:         *root,
+				hash:         docHash(mg.Tree),
+			})
+		}
+
+		obj.ruleSets = append(obj.ruleSets, ruleSet)
+	}
+
+	obj.hash = obj.rootHash()
+	return obj, nil
+}
@@ -0,0 +1,175 @@
+package rulesengine
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"jackfan.us.kg/lephones/prebid-server/rules"
+)
+
+// fakeSchemaFunc and fakeResultFunc are local test doubles, not anything
+// registered in production: DefaultRegistry's real functions (geo, device,
+// floors, ...) live outside this snapshot, so tests register their own
+// under names that won't collide with them.
+type fakeSchemaFunc struct {
+	name string
+	ret  string
+}
+
+func (f *fakeSchemaFunc) Call(payload *Payload) (string, error) { return f.ret, nil }
+func (f *fakeSchemaFunc) Name() string                          { return f.name }
+
+type fakeResultFunc struct {
+	name string
+}
+
+func (f *fakeResultFunc) Call(payload *Payload, result *Result, meta rules.ResultFunctionMeta) error {
+	return nil
+}
+func (f *fakeResultFunc) Name() string { return f.name }
+
+func newTestRegistry(t *testing.T) *rules.Registry[Payload, Result] {
+	t.Helper()
+
+	reg := rules.NewRegistry[Payload, Result]()
+	if err := reg.RegisterSchema("choose", func(args json.RawMessage) (rules.SchemaFunction[Payload], error) {
+		var cfg struct {
+			Ret string `json:"ret"`
+		}
+		if len(args) > 0 {
+			if err := json.Unmarshal(args, &cfg); err != nil {
+				return nil, err
+			}
+		}
+		return &fakeSchemaFunc{name: "choose", ret: cfg.Ret}, nil
+	}); err != nil {
+		t.Fatalf("registering choose: %v", err)
+	}
+	if err := reg.RegisterResult("floor", func(args json.RawMessage) (rules.ResultFunction[Payload, Result], error) {
+		return &fakeResultFunc{name: "floor"}, nil
+	}); err != nil {
+		t.Fatalf("registering floor: %v", err)
+	}
+	return reg
+}
+
+var registerTestFunctionsOnce sync.Once
+
+// ensureDefaultRegistryHasTestFunctions registers the same "choose"/"floor"
+// functions newTestRegistry does, but into the real DefaultRegistry, for
+// tests that exercise NewCacheObject/refreshCacheObject end to end (those
+// always resolve against DefaultRegistry, not a test-local one). Guarded by
+// sync.Once since DefaultRegistry is a process-wide singleton and a second
+// RegisterSchema/RegisterResult call for the same name errors.
+func ensureDefaultRegistryHasTestFunctions(t *testing.T) {
+	t.Helper()
+	registerTestFunctionsOnce.Do(func() {
+		if err := DefaultRegistry.RegisterSchema("choose", func(args json.RawMessage) (rules.SchemaFunction[Payload], error) {
+			var cfg struct {
+				Ret string `json:"ret"`
+			}
+			if len(args) > 0 {
+				if err := json.Unmarshal(args, &cfg); err != nil {
+					return nil, err
+				}
+			}
+			return &fakeSchemaFunc{name: "choose", ret: cfg.Ret}, nil
+		}); err != nil {
+			t.Fatalf("registering choose into DefaultRegistry: %v", err)
+		}
+		if err := DefaultRegistry.RegisterResult("floor", func(args json.RawMessage) (rules.ResultFunction[Payload, Result], error) {
+			return &fakeResultFunc{name: "floor"}, nil
+		}); err != nil {
+			t.Fatalf("registering floor into DefaultRegistry: %v", err)
+		}
+	})
+}
+
+func TestBuildNode_CompilesSchemaAndResultFunctions(t *testing.T) {
+	reg := newTestRegistry(t)
+	cache := rules.NewHashCache[Payload, Result]()
+
+	doc := nodeDoc{
+		SchemaFunc: &funcDoc{Func: "choose", Args: json.RawMessage(`{"ret":"US"}`)},
+		Children: map[string]nodeDoc{
+			"US": {ResultFuncs: []funcDoc{{Func: "floor", Args: json.RawMessage(`{"value":1.5}`)}}},
+		},
+	}
+
+	root, err := buildNode(doc, reg, cache)
+	if err != nil {
+		t.Fatalf("buildNode: %v", err)
+	}
+	if root.SchemaFunction == nil || root.SchemaFunction.Name() != "choose" {
+		t.Fatalf("expected root schema function %q, got %+v", "choose", root.SchemaFunction)
+	}
+	child, ok := root.Children["US"]
+	if !ok {
+		t.Fatalf("expected a US child")
+	}
+	if len(child.ResultFunctions) != 1 {
+		t.Fatalf("got %d result functions on the US leaf, want 1", len(child.ResultFunctions))
+	}
+	if _, ok := child.ResultFunctions[0].(*fakeResultFunc); !ok {
+		t.Fatalf("expected the US leaf's result function to be the one built by the \"floor\" constructor, got %T", child.ResultFunctions[0])
+	}
+}
+
+func TestBuildNode_DedupsIdenticalSubtreesAcrossModelGroups(t *testing.T) {
+	reg := newTestRegistry(t)
+	cache := rules.NewHashCache[Payload, Result]()
+
+	leaf := nodeDoc{ResultFuncs: []funcDoc{{Func: "floor", Args: json.RawMessage(`{"value":1.5}`)}}}
+
+	a, err := buildNode(leaf, reg, cache)
+	if err != nil {
+		t.Fatalf("buildNode a: %v", err)
+	}
+	b, err := buildNode(leaf, reg, cache)
+	if err != nil {
+		t.Fatalf("buildNode b: %v", err)
+	}
+	if a != b {
+		t.Fatalf("expected two structurally identical leaves to dedup to the same *rules.Node")
+	}
+}
+
+func TestDocHash_ArgsOnlyEditChangesHash(t *testing.T) {
+	base := nodeDoc{ResultFuncs: []funcDoc{{Func: "floor", Args: json.RawMessage(`{"value":1.5}`)}}}
+	edited := nodeDoc{ResultFuncs: []funcDoc{{Func: "floor", Args: json.RawMessage(`{"value":2.0}`)}}}
+
+	if docHash(base) == docHash(edited) {
+		t.Fatalf("expected an args-only edit to change the hash")
+	}
+}
+
+func TestDocHash_StructurallyIdenticalDocsMatch(t *testing.T) {
+	build := func() nodeDoc {
+		return nodeDoc{
+			SchemaFunc: &funcDoc{Func: "choose", Args: json.RawMessage(`{"ret":"US"}`)},
+			Children: map[string]nodeDoc{
+				"US": {ResultFuncs: []funcDoc{{Func: "floor", Args: json.RawMessage(`{"value":1.5}`)}}},
+			},
+		}
+	}
+
+	if docHash(build()) != docHash(build()) {
+		t.Fatalf("expected identical docs to hash the same")
+	}
+}
+
+func TestDocHash_ChildOrderDoesNotAffectHash(t *testing.T) {
+	a := nodeDoc{Children: map[string]nodeDoc{
+		"US": {SchemaFunc: &funcDoc{Func: "choose", Args: json.RawMessage(`{"ret":"1"}`)}},
+		"FR": {SchemaFunc: &funcDoc{Func: "choose", Args: json.RawMessage(`{"ret":"2"}`)}},
+	}}
+	b := nodeDoc{Children: map[string]nodeDoc{
+		"FR": {SchemaFunc: &funcDoc{Func: "choose", Args: json.RawMessage(`{"ret":"2"}`)}},
+		"US": {SchemaFunc: &funcDoc{Func: "choose", Args: json.RawMessage(`{"ret":"1"}`)}},
+	}}
+
+	if docHash(a) != docHash(b) {
+		t.Fatalf("expected map iteration order not to affect the hash")
+	}
+}
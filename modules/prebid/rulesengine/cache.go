@@ -1,20 +1,50 @@
 package rulesengine
 
 import (
-	// "crypto/sha256"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"jackfan.us.kg/lephones/prebid-server/rules"
 )
 
 // Is sync.Map the best choice for our use case? Would it better to use a go map with mutex?
 
+// cacheTTL is how long a cacheObject is served before refresher considers it
+// due for a rebuild.
+const cacheTTL = 5 * time.Minute
+
+// treeHashCacheIdleTTL bounds how long a compiled subtree is kept in
+// treeHashCache once nothing resolves to its hash anymore, so the cache
+// doesn't grow for the life of the process: every args-only config edit
+// mints a hash that's never looked up again once the edit has rolled out
+// everywhere, and a long-running, multi-tenant process sees an effectively
+// unbounded number of those over time. treeHashCacheSweepEvery amortizes
+// the cost of checking by only scanning the cache every N refreshes rather
+// than on every one.
+const (
+	treeHashCacheIdleTTL    = 24 * time.Hour
+	treeHashCacheSweepEvery = 1000
+)
+
+// refreshCount drives the lazy sweep in refreshCacheObject; it has no
+// meaning beyond "how many times has refreshCacheObject run".
+var refreshCount uint64
+
 // TTL expiration check every 5 min
-// When TTL expires, perform raw JSON hash diff to determine if tree rebuild is needed
+// When TTL expires, walk the new config and compute a content hash per node
+// (see docHash in builder.go); only the subtrees whose hash changed are
+// re-materialized, and unchanged subtrees are grafted from the old tree via
+// treeHashCache.
 
 type cacheObject struct {
-    ts       time.Time
-	cfg      json.RawMessage // TODO: change to hash
+	ts       time.Time
+	cfg      json.RawMessage
+	hash     rules.Hash // root hash of the full ruleset, exposed for auditing
 	ruleSets []cacheRuleSet
 }
 type cacheRuleSet struct {
@@ -28,14 +58,66 @@ type cacheModelGroup struct {
 	analyticsKey string
 	defaults     []Function
 	root         Node
+	hash         rules.Hash
+}
+
+// treeHashCache is shared across refreshes of every account so that a
+// subtree appearing in multiple model groups, or surviving unchanged across
+// a TTL refresh, is only ever compiled once.
+var treeHashCache = rules.NewHashCache[Payload, Result]()
+
+// NewCacheObject is defined in builder.go, which compiles cfg's rulesets
+// into this cacheObject via DefaultRegistry and treeHashCache.
+
+// rootHash folds every model group's hash into one stable hash for the
+// whole ruleset, which operators can log/expose as the account's "ruleset
+// root hash" for auditing. Model groups are included sorted by their
+// stage/name/version key, so unrelated reordering of unrelated rulesets
+// in the source config doesn't change it.
+func (o cacheObject) rootHash() rules.Hash {
+	type entry struct {
+		Key  string     `json:"key"`
+		Hash rules.Hash `json:"hash"`
+	}
+
+	entries := make([]entry, 0)
+	for _, rs := range o.ruleSets {
+		for _, mg := range rs.modelGroups {
+			entries = append(entries, entry{Key: rs.stage + "/" + rs.name + "/" + mg.version, Hash: mg.hash})
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	b, _ := json.Marshal(entries)
+	sum := sha256.Sum256(b)
+	return rules.Hash(hex.EncodeToString(sum[:]))
 }
 
-func NewCacheObject(cfg config) (cacheObject, error) {
-	return cacheObject{}, nil
+// refreshCacheObject rebuilds a cacheObject from cfg. It doesn't need to
+// graft subtrees from old itself: NewCacheObject's buildNode already hashes
+// every node against the shared treeHashCache as it compiles, so a subtree
+// whose hash is unchanged since old resolves to the exact same compiled
+// *rules.Node old was using, for free. old is accepted (rather than dropped
+// from the signature) so a future staleness/eviction policy has a natural
+// place to consult it; it isn't otherwise used.
+//
+// Every call is also a chance to bound treeHashCache, which otherwise keeps
+// every subtree hash it's ever seen for the life of the process.
+func refreshCacheObject(old *cacheObject, cfg config) (cacheObject, error) {
+	next, err := NewCacheObject(cfg)
+	if err != nil {
+		return cacheObject{}, err
+	}
+
+	if atomic.AddUint64(&refreshCount, 1)%treeHashCacheSweepEvery == 0 {
+		treeHashCache.Prune(treeHashCacheIdleTTL)
+	}
+
+	return next, nil
 }
 
 type cacher interface {
-	Get(string) (*cacheObject)
+	Get(string) *cacheObject
 	Set(string, cacheObject)
 	Delete(id string)
 }
@@ -52,10 +134,12 @@ func (c *cache) Get(id string) (data *cacheObject) {
 	return nil
 }
 
-func (c *cache) Save(id string, data cacheObject) {
-	c.Map.Store(id, data)
+func (c *cache) Set(id string, data cacheObject) {
+	// Stored as *cacheObject, not cacheObject, to match the type Get asserts
+	// back out of the map.
+	c.Map.Store(id, &data)
 }
 
 func (c *cache) Delete(id string) {
 	c.Map.Delete(id)
-}
\ No newline at end of file
+}
@@ -0,0 +1,93 @@
+package rulesengine
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func testConfigJSON(resultArgs string) config {
+	doc := `{
+		"ruleSets": [{
+			"stage": "auction",
+			"name": "floors",
+			"modelGroups": [{
+				"weight": 100,
+				"version": "v1",
+				"analyticsKey": "floors-v1",
+				"tree": {
+					"schemaFunc": {"func": "choose", "args": {"ret":"US"}},
+					"children": {
+						"US": {"resultFuncs": [{"func": "floor", "args": ` + resultArgs + `}]}
+					}
+				}
+			}]
+		}]
+	}`
+	return config{cfg: json.RawMessage(doc)}
+}
+
+func TestNewCacheObject_BuildsRuleSetsFromConfig(t *testing.T) {
+	ensureDefaultRegistryHasTestFunctions(t)
+
+	obj, err := NewCacheObject(testConfigJSON(`{"value":1.5}`))
+	if err != nil {
+		t.Fatalf("NewCacheObject: %v", err)
+	}
+	if len(obj.ruleSets) != 1 || len(obj.ruleSets[0].modelGroups) != 1 {
+		t.Fatalf("expected one ruleset with one model group, got %+v", obj.ruleSets)
+	}
+
+	mg := obj.ruleSets[0].modelGroups[0]
+	if mg.version != "v1" || mg.analyticsKey != "floors-v1" {
+		t.Fatalf("got model group %+v, want version v1 / analyticsKey floors-v1", mg)
+	}
+	if mg.root.SchemaFunction == nil {
+		t.Fatalf("expected the compiled root to carry its schema function")
+	}
+}
+
+func TestRefreshCacheObject_ReusesNodeWhenHashUnchanged(t *testing.T) {
+	ensureDefaultRegistryHasTestFunctions(t)
+
+	old, err := NewCacheObject(testConfigJSON(`{"value":1.5}`))
+	if err != nil {
+		t.Fatalf("NewCacheObject: %v", err)
+	}
+
+	next, err := refreshCacheObject(&old, testConfigJSON(`{"value":1.5}`))
+	if err != nil {
+		t.Fatalf("refreshCacheObject: %v", err)
+	}
+
+	oldLeaf := old.ruleSets[0].modelGroups[0].root.Children["US"]
+	nextLeaf := next.ruleSets[0].modelGroups[0].root.Children["US"]
+	if oldLeaf != nextLeaf {
+		t.Fatalf("expected an unchanged leaf to resolve to the same compiled *rules.Node across a refresh")
+	}
+}
+
+func TestRefreshCacheObject_RecompilesWhenArgsChange(t *testing.T) {
+	ensureDefaultRegistryHasTestFunctions(t)
+
+	old, err := NewCacheObject(testConfigJSON(`{"value":1.5}`))
+	if err != nil {
+		t.Fatalf("NewCacheObject: %v", err)
+	}
+
+	next, err := refreshCacheObject(&old, testConfigJSON(`{"value":2.0}`))
+	if err != nil {
+		t.Fatalf("refreshCacheObject: %v", err)
+	}
+
+	oldHash := old.ruleSets[0].modelGroups[0].hash
+	nextHash := next.ruleSets[0].modelGroups[0].hash
+	if oldHash == nextHash {
+		t.Fatalf("expected an args-only edit to change the model group's recorded hash")
+	}
+
+	oldLeaf := old.ruleSets[0].modelGroups[0].root.Children["US"]
+	nextLeaf := next.ruleSets[0].modelGroups[0].root.Children["US"]
+	if oldLeaf == nextLeaf {
+		t.Fatalf("expected an args-only edit to recompile the affected leaf instead of grafting the stale one")
+	}
+}
@@ -0,0 +1,85 @@
+package rulesengine
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"sort"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrate brings db's schema up to date by applying, in file name order,
+// every migrations/*.sql file whose position in that order (counting from
+// 1) is above the db's current schema_version, each in its own
+// transaction; the number in a file's name is not parsed. It's safe to call on every startup: with nothing
+// pending it's a no-op.
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("creating schema_version table: %w", err)
+	}
+
+	version, err := currentSchemaVersion(db)
+	if err != nil {
+		return fmt.Errorf("reading schema_version: %w", err)
+	}
+
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return fmt.Errorf("reading migrations: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for i, entry := range entries {
+		seq := i + 1
+		if seq <= version {
+			continue
+		}
+
+		sqlBytes, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return fmt.Errorf("reading migration %s: %w", entry.Name(), err)
+		}
+
+		if err := applyMigration(db, seq, string(sqlBytes)); err != nil {
+			return fmt.Errorf("applying migration %s: %w", entry.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+func currentSchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	row := db.QueryRow(`SELECT version FROM schema_version LIMIT 1`)
+	switch err := row.Scan(&version); err {
+	case nil:
+		return version, nil
+	case sql.ErrNoRows:
+		return 0, nil
+	default:
+		return 0, err
+	}
+}
+
+func applyMigration(db *sql.DB, seq int, sqlText string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(sqlText); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM schema_version`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, seq); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
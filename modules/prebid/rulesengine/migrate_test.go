@@ -0,0 +1,55 @@
+package rulesengine
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "jackfan.us.kg/mattn/go-sqlite3"
+)
+
+func TestMigrate_CreatesSchemaAndIsIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "migrate.db")
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	defer db.Close()
+
+	if err := migrate(db); err != nil {
+		t.Fatalf("first migrate: %v", err)
+	}
+
+	version, err := currentSchemaVersion(db)
+	if err != nil {
+		t.Fatalf("currentSchemaVersion: %v", err)
+	}
+	if version == 0 {
+		t.Fatalf("expected schema_version to advance past 0 after migrating")
+	}
+
+	if _, err := db.Exec(
+		`INSERT INTO cache_object (account_id, cfg, hash, ts, ruleSets) VALUES (?, ?, ?, ?, ?)`,
+		"acct", []byte(`{}`), "h", int64(0), []byte(`[]`),
+	); err != nil {
+		t.Fatalf("expected cache_object table to exist after migrate: %v", err)
+	}
+
+	if err := migrate(db); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+
+	version2, err := currentSchemaVersion(db)
+	if err != nil {
+		t.Fatalf("currentSchemaVersion after second migrate: %v", err)
+	}
+	if version2 != version {
+		t.Fatalf("expected schema_version to stay at %d on a no-op re-migrate, got %d", version, version2)
+	}
+
+	var accountID string
+	if err := db.QueryRow(`SELECT account_id FROM cache_object WHERE account_id = ?`, "acct").Scan(&accountID); err != nil {
+		t.Fatalf("expected the row inserted before the second migrate to survive: %v", err)
+	}
+}
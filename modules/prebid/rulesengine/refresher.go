@@ -0,0 +1,158 @@
+package rulesengine
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
+)
+
+// configSource fetches the latest config for an account id from PBS's
+// config source. It's the thing refresher coalesces and rate-limits calls
+// into.
+type configSource interface {
+	Fetch(id string) (config, error)
+}
+
+// rebuildMetrics records refresher outcomes for observability. A nil
+// rebuildMetrics is valid; refresher simply skips recording.
+type rebuildMetrics interface {
+	RecordRuleSetRebuild(accountID string)
+	RecordRuleSetRebuildRateLimited(accountID string)
+}
+
+// perAccountIdleTTL bounds how long a per-account rate.Limiter is kept once
+// nothing has asked for it: without this, perAccount grows by one entry per
+// distinct account id ever seen, for the life of the process, which is a
+// slow leak in a long-running, multi-tenant server. perAccountSweepEvery
+// amortizes the cost of checking by only scanning the map every N calls to
+// limiterFor rather than on every one.
+const (
+	perAccountIdleTTL    = 30 * time.Minute
+	perAccountSweepEvery = 4096
+)
+
+// accountLimiter pairs a per-account rate.Limiter with the last time it was
+// asked for, so limiterFor's sweep can tell which accounts are still active.
+type accountLimiter struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// refresher wraps a cacher so that concurrent misses or TTL expiries for the
+// same account id coalesce into a single rebuild via singleflight, and
+// rebuilds are bounded both globally and per-account via rate.Limiter. This
+// protects the config source from a thundering herd the same way the
+// DNS-based discovery resolver protects itself against one. When a rebuild
+// is rate-limited, refresher serves the stale cacheObject already in cache
+// rather than blocking the caller, since an auction blocked on config
+// refresh is worse than one running against a slightly stale ruleset.
+type refresher struct {
+	cacher
+	source  configSource
+	metrics rebuildMetrics
+
+	group  singleflight.Group
+	global *rate.Limiter
+
+	perAccountLimit rate.Limit
+	perAccountBurst int
+	mu              sync.Mutex
+	perAccount      map[string]*accountLimiter
+	calls           uint64
+}
+
+// newRefresher returns a refresher that allows up to globalRPS rebuilds/sec
+// across all accounts (burst globalBurst) and up to perAccountRPS
+// rebuilds/sec per account (burst perAccountBurst).
+func newRefresher(c cacher, source configSource, metrics rebuildMetrics, globalRPS rate.Limit, globalBurst int, perAccountRPS rate.Limit, perAccountBurst int) *refresher {
+	return &refresher{
+		cacher:          c,
+		source:          source,
+		metrics:         metrics,
+		global:          rate.NewLimiter(globalRPS, globalBurst),
+		perAccountLimit: perAccountRPS,
+		perAccountBurst: perAccountBurst,
+		perAccount:      make(map[string]*accountLimiter),
+	}
+}
+
+func (r *refresher) limiterFor(id string) *rate.Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.calls++
+	if r.calls%perAccountSweepEvery == 0 {
+		r.sweepIdleAccountsLocked(now)
+	}
+
+	al, ok := r.perAccount[id]
+	if !ok {
+		al = &accountLimiter{limiter: rate.NewLimiter(r.perAccountLimit, r.perAccountBurst)}
+		r.perAccount[id] = al
+	}
+	al.lastUsed = now
+	return al.limiter
+}
+
+// sweepIdleAccountsLocked discards per-account limiters idle for longer than
+// perAccountIdleTTL. Callers must hold r.mu.
+func (r *refresher) sweepIdleAccountsLocked(now time.Time) {
+	for id, al := range r.perAccount {
+		if now.Sub(al.lastUsed) > perAccountIdleTTL {
+			delete(r.perAccount, id)
+		}
+	}
+}
+
+// Get returns the cached ruleset for id, triggering a rebuild when it's
+// missing or past cacheTTL. Concurrent Gets for the same id racing a
+// rebuild all wait on the one in-flight rebuild instead of each fetching
+// cfg and recompiling independently — including the rate-limit check
+// itself: it runs once, inside the singleflight leader's call, so a
+// thundering herd of concurrent misses spends exactly one token and every
+// follower gets the leader's result, rather than each of N callers
+// independently consuming a token and most of them bailing out to stale
+// before ever reaching singleflight. If the global or per-account limiter
+// rejects the rebuild, the leader's call serves the stale object (nil if
+// there has never been a successful build) and records a metric instead of
+// blocking.
+func (r *refresher) Get(id string) *cacheObject {
+	stale := r.cacher.Get(id)
+	if stale != nil && time.Since(stale.ts) < cacheTTL {
+		return stale
+	}
+
+	v, err, _ := r.group.Do(id, func() (any, error) {
+		if !r.global.Allow() || !r.limiterFor(id).Allow() {
+			if r.metrics != nil {
+				r.metrics.RecordRuleSetRebuildRateLimited(id)
+			}
+			return stale, nil
+		}
+
+		cfg, err := r.source.Fetch(id)
+		if err != nil {
+			return nil, err
+		}
+
+		next, err := refreshCacheObject(stale, cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		next.ts = time.Now()
+		r.cacher.Set(id, next)
+		if r.metrics != nil {
+			r.metrics.RecordRuleSetRebuild(id)
+		}
+		return &next, nil
+	})
+	if err != nil {
+		return stale
+	}
+
+	return v.(*cacheObject)
+}
@@ -0,0 +1,214 @@
+package rulesengine
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type countingSource struct {
+	mu    sync.Mutex
+	calls int
+	cfg   config
+}
+
+func (s *countingSource) Fetch(id string) (config, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	return s.cfg, nil
+}
+
+func (s *countingSource) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+// blockingSource blocks inside Fetch until release is closed, and closes
+// entered once it's inside Fetch, so a test can deterministically arrange
+// for other goroutines to call refresher.Get while a rebuild is already
+// in flight instead of hoping goroutine scheduling happens to overlap them.
+type blockingSource struct {
+	mu      sync.Mutex
+	calls   int
+	entered chan struct{}
+	release chan struct{}
+	cfg     config
+}
+
+func newBlockingSource() *blockingSource {
+	return &blockingSource{entered: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (s *blockingSource) Fetch(id string) (config, error) {
+	s.mu.Lock()
+	s.calls++
+	first := s.calls == 1
+	s.mu.Unlock()
+	if first {
+		close(s.entered)
+	}
+	<-s.release
+	return s.cfg, nil
+}
+
+func (s *blockingSource) callCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+type countingMetrics struct {
+	mu          sync.Mutex
+	rebuilds    int
+	rateLimited int
+}
+
+func (m *countingMetrics) RecordRuleSetRebuild(accountID string) {
+	m.mu.Lock()
+	m.rebuilds++
+	m.mu.Unlock()
+}
+
+func (m *countingMetrics) RecordRuleSetRebuildRateLimited(accountID string) {
+	m.mu.Lock()
+	m.rateLimited++
+	m.mu.Unlock()
+}
+
+type mapCacher struct {
+	mu    sync.Mutex
+	store map[string]cacheObject
+}
+
+func newMapCacher() *mapCacher { return &mapCacher{store: make(map[string]cacheObject)} }
+
+func (c *mapCacher) Get(id string) *cacheObject {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	obj, ok := c.store[id]
+	if !ok {
+		return nil
+	}
+	return &obj
+}
+
+func (c *mapCacher) Set(id string, obj cacheObject) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store[id] = obj
+}
+
+func (c *mapCacher) Delete(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.store, id)
+}
+
+func TestRefresherGet_ServesFreshCacheWithoutFetching(t *testing.T) {
+	source := &countingSource{}
+	c := newMapCacher()
+	c.Set("acct", cacheObject{ts: time.Now()})
+
+	r := newRefresher(c, source, nil, rate.Inf, 1, rate.Inf, 1)
+
+	r.Get("acct")
+
+	if got := source.callCount(); got != 0 {
+		t.Fatalf("got %d Fetch calls for a cache entry within TTL, want 0", got)
+	}
+}
+
+func TestRefresherGet_RateLimitedSingleCallServesStale(t *testing.T) {
+	source := &countingSource{}
+	c := newMapCacher()
+	stale := cacheObject{ts: time.Now().Add(-2 * cacheTTL)}
+	c.Set("acct", stale)
+
+	metrics := &countingMetrics{}
+	// burst 0 means Allow() never succeeds, simulating a saturated limiter.
+	r := newRefresher(c, source, metrics, rate.Limit(0), 0, rate.Limit(0), 0)
+
+	got := r.Get("acct")
+
+	if callCount := source.callCount(); callCount != 0 {
+		t.Fatalf("a saturated limiter should never let Fetch run, got %d calls", callCount)
+	}
+	if metrics.rateLimited != 1 {
+		t.Fatalf("got %d rate-limited recordings, want 1", metrics.rateLimited)
+	}
+	if got == nil || !got.ts.Equal(stale.ts) {
+		t.Fatalf("expected the stale object back when rate-limited")
+	}
+}
+
+// TestRefresherGet_FollowersShareLeadersCoalescedRebuild is the regression
+// test for moving the rate-limit check inside the singleflight leader: with
+// only one token available (burst 1) and 20 concurrent callers, the old
+// code had every caller spend its own Allow() check before ever reaching
+// singleflight, so 19 of them would be rejected and fall back to a nil/stale
+// object instead of riding along with the one rebuild that actually ran.
+func TestRefresherGet_FollowersShareLeadersCoalescedRebuild(t *testing.T) {
+	const n = 20
+
+	source := newBlockingSource()
+	c := newMapCacher()
+	metrics := &countingMetrics{}
+	r := newRefresher(c, source, metrics, rate.Limit(0), 1, rate.Limit(0), 1)
+
+	results := make([]*cacheObject, n)
+	var wg sync.WaitGroup
+
+	// Start the leader and wait until it's actually inside Fetch (i.e. it
+	// has already claimed the one available token and committed to a
+	// rebuild) before starting the rest, so the rest start while that
+	// singleflight call is still in flight and can join it rather than
+	// each getting a fresh, possibly-unratelimited shot on their own. One
+	// that runs late may instead find the leader's result in the cache
+	// (see the check at the end).
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		results[0] = r.Get("acct")
+	}()
+	<-source.entered
+
+	for i := 1; i < n; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = r.Get("acct")
+		}()
+	}
+
+	close(source.release)
+	wg.Wait()
+
+	if got := source.callCount(); got != 1 {
+		t.Fatalf("got %d Fetch calls for %d coalesced callers, want 1", got, n)
+	}
+	if metrics.rateLimited != 0 {
+		t.Fatalf("got %d rate-limited recordings, want 0 (the one token should have covered the whole coalesced wave)", metrics.rateLimited)
+	}
+	if metrics.rebuilds != 1 {
+		t.Fatalf("got %d rebuild recordings, want 1", metrics.rebuilds)
+	}
+
+	for i, obj := range results {
+		if obj == nil {
+			t.Fatalf("results[%d] is nil: a coalesced follower should share the leader's rebuilt object, not fall back to stale", i)
+		}
+		// A follower may observe the rebuild either by waiting on the
+		// singleflight call directly or, if it's scheduled late enough, by
+		// finding the leader's result already published to the cache - both
+		// are valid ways to benefit from the one coalesced rebuild, so
+		// compare by value rather than requiring the identical pointer.
+		if !obj.ts.Equal(results[0].ts) {
+			t.Fatalf("results[%d].ts = %v, want %v (the leader's rebuilt timestamp)", i, obj.ts, results[0].ts)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+package rulesengine
+
+import "jackfan.us.kg/lephones/prebid-server/rules"
+
+// DefaultRegistry is the process-wide SchemaFunction/ResultFunction registry
+// used to build every account's Tree. Third-party packages shipping their
+// own rule primitives (geo, device, floors, experiment bucketing) register
+// into it from their own init() via MustRegisterSchema/MustRegisterResult.
+var DefaultRegistry = rules.NewRegistry[Payload, Result]()
@@ -0,0 +1,40 @@
+package rulesengine
+
+import "jackfan.us.kg/lephones/prebid-server/rules"
+
+// defaultRunnerConcurrency bounds how many model groups of a single
+// cacheRuleSet evaluate concurrently. A group that finds every worker slot
+// taken when it is dispatched runs inline on the calling goroutine instead.
+const defaultRunnerConcurrency = 8
+
+// ruleSetRunner evaluates every model group of a cacheRuleSet against a
+// payload, e.g. the weighted A/B splits and shadow groups a single stage's
+// ruleset often declares, all of which must run. The returned results and
+// errors are in config-declared order regardless of which goroutine
+// finishes first. Each group's result functions are called on the goroutine
+// that evaluates it, so calls into result functions of different groups
+// can interleave in any order.
+type ruleSetRunner struct {
+	concurrency int
+}
+
+func newRuleSetRunner() *ruleSetRunner {
+	return &ruleSetRunner{concurrency: defaultRunnerConcurrency}
+}
+
+// RunAll evaluates every model group in rs against payload, returning one
+// *Result per model group in the same order as rs.modelGroups and one error
+// per group alongside it.
+func (r *ruleSetRunner) RunAll(rs cacheRuleSet, payload *Payload) ([]*Result, []error) {
+	trees := make([]*rules.Tree[Payload, Result], len(rs.modelGroups))
+	results := make([]*Result, len(rs.modelGroups))
+
+	for i := range rs.modelGroups {
+		mg := &rs.modelGroups[i]
+		trees[i] = &rules.Tree[Payload, Result]{Root: &mg.root, DefaultFunctions: mg.defaults}
+		results[i] = new(Result)
+	}
+
+	errs := rules.RunAll(trees, payload, results, r.concurrency)
+	return results, errs
+}
@@ -0,0 +1,70 @@
+package rulesengine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"jackfan.us.kg/lephones/prebid-server/rules"
+)
+
+// indexedResultFunc records which model group's result function ran,
+// without needing to know Result's concrete fields.
+type indexedResultFunc struct {
+	idx   int
+	mu    *sync.Mutex
+	order *[]int
+}
+
+func (f *indexedResultFunc) Call(payload *Payload, result *Result, meta rules.ResultFunctionMeta) error {
+	f.mu.Lock()
+	*f.order = append(*f.order, f.idx)
+	f.mu.Unlock()
+	return nil
+}
+func (f *indexedResultFunc) Name() string { return fmt.Sprintf("idx%d", f.idx) }
+
+func TestRuleSetRunner_RunAllRunsEveryModelGroupOnce(t *testing.T) {
+	const n = 6
+
+	var mu sync.Mutex
+	var order []int
+
+	rs := cacheRuleSet{stage: "auction", name: "floors"}
+	for i := 0; i < n; i++ {
+		rs.modelGroups = append(rs.modelGroups, cacheModelGroup{
+			version: fmt.Sprintf("v%d", i),
+			root: Node{
+				ResultFunctions: []Function{&indexedResultFunc{idx: i, mu: &mu, order: &order}},
+			},
+		})
+	}
+
+	runner := newRuleSetRunner()
+	payload := Payload{}
+	results, errs := runner.RunAll(rs, &payload)
+
+	if len(results) != n || len(errs) != n {
+		t.Fatalf("got %d results / %d errs, want %d", len(results), len(errs), n)
+	}
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("model group %d: unexpected error: %v", i, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != n {
+		t.Fatalf("got %d result function invocations, want %d", len(order), n)
+	}
+	ran := make([]bool, n)
+	for _, idx := range order {
+		ran[idx] = true
+	}
+	for i, ok := range ran {
+		if !ok {
+			t.Fatalf("model group %d's result function never ran", i)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package rulesengine
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"jackfan.us.kg/golang/glog"
+	_ "jackfan.us.kg/mattn/go-sqlite3"
+
+	"jackfan.us.kg/lephones/prebid-server/rules"
+)
+
+// CacheBackend selects which cacher implementation NewCacher builds.
+type CacheBackend string
+
+const (
+	// CacheBackendMemory is the pure sync.Map-backed cache with no
+	// persistence; every process restart cold-starts every account's
+	// ruleset compilation. This is the default, and what tests and small
+	// deployments should keep using.
+	CacheBackendMemory CacheBackend = "memory"
+	// CacheBackendSQLite layers the in-memory cache in front of a local
+	// SQLite file, so after a restart each account's last persisted config
+	// and refresh timestamp are read back instead of being fetched again.
+	// The compiled ruleset is not persisted: it is recompiled from that
+	// config on the first read after every restart.
+	CacheBackendSQLite CacheBackend = "sqlite"
+)
+
+// NewCacher builds the cacher selected by backend. sqlitePath is only used
+// when backend is CacheBackendSQLite.
+func NewCacher(backend CacheBackend, sqlitePath string) (cacher, error) {
+	mem := &cache{Map: &sync.Map{}}
+
+	switch backend {
+	case CacheBackendSQLite:
+		persistent, err := newSQLiteCache(sqlitePath)
+		if err != nil {
+			return nil, err
+		}
+		return newLayeredCache(mem, persistent), nil
+	default:
+		return mem, nil
+	}
+}
+
+// sqliteRow is the persisted shape of a cacheObject: config bytes, the
+// computed ruleset root hash, the refresh timestamp, and per-modelGroup
+// metadata, stored so a PBS restart doesn't cold-start every account's
+// ruleset compilation.
+type sqliteRow struct {
+	AccountID string              `json:"accountID"`
+	Cfg       json.RawMessage     `json:"cfg"`
+	Hash      rules.Hash          `json:"hash"`
+	TS        time.Time           `json:"ts"`
+	RuleSets  []sqliteRuleSetMeta `json:"ruleSets"`
+}
+
+// sqliteRuleSetMeta is the part of a cacheRuleSet worth persisting; the
+// compiled root nodes themselves are rebuilt from Cfg on load rather than
+// serialized, since SchemaFunction/ResultFunction values aren't.
+type sqliteRuleSetMeta struct {
+	Stage       string                 `json:"stage"`
+	Name        string                 `json:"name"`
+	ModelGroups []sqliteModelGroupMeta `json:"modelGroups"`
+}
+
+type sqliteModelGroupMeta struct {
+	Weight       int        `json:"weight"`
+	Version      string     `json:"version"`
+	AnalyticsKey string     `json:"analyticsKey"`
+	Hash         rules.Hash `json:"hash"`
+}
+
+// sqliteCache stores cacheObjects in a local SQLite file and is the
+// persistent tier behind the in-memory cache in layeredCache. Its Set and
+// Delete return an error, so it does not satisfy cacher on its own; it is
+// used through layeredCache. After a restart, Get reads back an account's
+// persisted cfg and ts and recompiles the ruleset from that cfg.
+type sqliteCache struct {
+	db *sql.DB
+}
+
+// newSQLiteCache opens (creating if necessary) the SQLite file at path and
+// applies any pending migrations from the migrations directory.
+func newSQLiteCache(path string) (*sqliteCache, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("rulesengine: opening sqlite cache at %q: %w", path, err)
+	}
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("rulesengine: migrating sqlite cache at %q: %w", path, err)
+	}
+
+	return &sqliteCache{db: db}, nil
+}
+
+// Get reads back the persisted cfg for id and recompiles it into a usable
+// cacheObject via NewCacheObject — the row's hash/ruleSets columns are
+// metadata for operators inspecting the database directly, not a shortcut
+// around recompiling, since SchemaFunction/ResultFunction values can't be
+// serialized. ts is carried over from the row so a restart doesn't reset
+// the TTL clock and immediately force a rebuild of everything.
+func (s *sqliteCache) Get(id string) *cacheObject {
+	row := s.db.QueryRow(`SELECT cfg, ts FROM cache_object WHERE account_id = ?`, id)
+
+	var cfg []byte
+	var tsUnix int64
+	if err := row.Scan(&cfg, &tsUnix); err != nil {
+		return nil
+	}
+
+	obj, err := NewCacheObject(config{cfg: cfg})
+	if err != nil {
+		glog.Errorf("rulesengine: recompiling sqlite-cached config for account %q: %v", id, err)
+		return nil
+	}
+	obj.ts = time.Unix(tsUnix, 0)
+
+	return &obj
+}
+
+func (s *sqliteCache) Set(id string, data cacheObject) error {
+	meta := make([]sqliteRuleSetMeta, 0, len(data.ruleSets))
+	for _, rs := range data.ruleSets {
+		groups := make([]sqliteModelGroupMeta, 0, len(rs.modelGroups))
+		for _, mg := range rs.modelGroups {
+			groups = append(groups, sqliteModelGroupMeta{
+				Weight:       mg.weight,
+				Version:      mg.version,
+				AnalyticsKey: mg.analyticsKey,
+				Hash:         mg.hash,
+			})
+		}
+		meta = append(meta, sqliteRuleSetMeta{Stage: rs.stage, Name: rs.name, ModelGroups: groups})
+	}
+
+	ruleSets, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("rulesengine: marshaling ruleset metadata for account %q: %w", id, err)
+	}
+
+	if _, err := s.db.Exec(
+		`INSERT INTO cache_object (account_id, cfg, hash, ts, ruleSets) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(account_id) DO UPDATE SET cfg = excluded.cfg, hash = excluded.hash, ts = excluded.ts, ruleSets = excluded.ruleSets`,
+		id, []byte(data.cfg), string(data.hash), data.ts.Unix(), ruleSets,
+	); err != nil {
+		return fmt.Errorf("rulesengine: persisting cache object for account %q: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *sqliteCache) Delete(id string) error {
+	if _, err := s.db.Exec(`DELETE FROM cache_object WHERE account_id = ?`, id); err != nil {
+		return fmt.Errorf("rulesengine: deleting cache object for account %q: %w", id, err)
+	}
+	return nil
+}
+
+// layeredCache is a read-through, write-behind cacher: reads check the
+// in-memory tier first and fall back to the persistent tier on miss,
+// populating the in-memory tier as they go; writes land in the in-memory
+// tier immediately and are persisted asynchronously so a slow disk never
+// adds latency to the request that triggered the rebuild.
+type layeredCache struct {
+	mem        *cache
+	persistent *sqliteCache
+}
+
+func newLayeredCache(mem *cache, persistent *sqliteCache) *layeredCache {
+	return &layeredCache{mem: mem, persistent: persistent}
+}
+
+func (l *layeredCache) Get(id string) *cacheObject {
+	if obj := l.mem.Get(id); obj != nil {
+		return obj
+	}
+
+	obj := l.persistent.Get(id)
+	if obj != nil {
+		l.mem.Set(id, *obj)
+	}
+	return obj
+}
+
+func (l *layeredCache) Set(id string, data cacheObject) {
+	l.mem.Set(id, data)
+	go func() {
+		if err := l.persistent.Set(id, data); err != nil {
+			glog.Errorf("rulesengine: write-behind persist failed: %v", err)
+		}
+	}()
+}
+
+func (l *layeredCache) Delete(id string) {
+	l.mem.Delete(id)
+	go func() {
+		if err := l.persistent.Delete(id); err != nil {
+			glog.Errorf("rulesengine: write-behind delete failed: %v", err)
+		}
+	}()
+}
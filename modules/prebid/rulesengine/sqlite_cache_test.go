@@ -0,0 +1,122 @@
+package rulesengine
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestSQLiteCache(t *testing.T) *sqliteCache {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "cache.db")
+	c, err := newSQLiteCache(path)
+	if err != nil {
+		t.Fatalf("newSQLiteCache: %v", err)
+	}
+	t.Cleanup(func() { c.db.Close() })
+	return c
+}
+
+func TestSQLiteCache_SetThenGetRoundTrips(t *testing.T) {
+	c := newTestSQLiteCache(t)
+
+	obj := cacheObject{
+		cfg: []byte(`{"ruleSets":[]}`),
+		ts:  time.Unix(1700000000, 0),
+	}
+
+	if err := c.Set("acct", obj); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	got := c.Get("acct")
+	if got == nil {
+		t.Fatalf("Get returned nil after Set")
+	}
+	if !got.ts.Equal(obj.ts) {
+		t.Fatalf("got ts %v, want %v", got.ts, obj.ts)
+	}
+	if string(got.cfg) != string(obj.cfg) {
+		t.Fatalf("got cfg %s, want %s", got.cfg, obj.cfg)
+	}
+}
+
+func TestSQLiteCache_GetMissReturnsNil(t *testing.T) {
+	c := newTestSQLiteCache(t)
+	if got := c.Get("nope"); got != nil {
+		t.Fatalf("expected nil for a missing account, got %+v", got)
+	}
+}
+
+func TestSQLiteCache_SetOverwritesExistingRow(t *testing.T) {
+	c := newTestSQLiteCache(t)
+
+	first := cacheObject{cfg: []byte(`{}`), ts: time.Unix(1, 0)}
+	second := cacheObject{cfg: []byte(`{"ruleSets":[]}`), ts: time.Unix(2, 0)}
+
+	if err := c.Set("acct", first); err != nil {
+		t.Fatalf("Set first: %v", err)
+	}
+	if err := c.Set("acct", second); err != nil {
+		t.Fatalf("Set second: %v", err)
+	}
+
+	got := c.Get("acct")
+	if got == nil || !got.ts.Equal(second.ts) {
+		t.Fatalf("expected the second Set to overwrite the first")
+	}
+}
+
+func TestSQLiteCache_DeleteRemovesRow(t *testing.T) {
+	c := newTestSQLiteCache(t)
+
+	if err := c.Set("acct", cacheObject{cfg: []byte(`{}`), ts: time.Now()}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := c.Delete("acct"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got := c.Get("acct"); got != nil {
+		t.Fatalf("expected Get to return nil after Delete, got %+v", got)
+	}
+}
+
+func TestLayeredCache_GetFallsBackToPersistentOnMemoryMiss(t *testing.T) {
+	persistent := newTestSQLiteCache(t)
+	mem := &cache{Map: &sync.Map{}}
+	l := newLayeredCache(mem, persistent)
+
+	obj := cacheObject{cfg: []byte(`{}`), ts: time.Now()}
+	if err := persistent.Set("acct", obj); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	got := l.Get("acct")
+	if got == nil {
+		t.Fatalf("expected layeredCache.Get to fall back to the persistent tier")
+	}
+	if cached := mem.Get("acct"); cached == nil {
+		t.Fatalf("expected layeredCache.Get to populate the in-memory tier on a persistent hit")
+	}
+}
+
+func TestLayeredCache_GetPrefersMemoryOverPersistent(t *testing.T) {
+	persistent := newTestSQLiteCache(t)
+	mem := &cache{Map: &sync.Map{}}
+	l := newLayeredCache(mem, persistent)
+
+	stale := cacheObject{cfg: []byte(`{}`), ts: time.Unix(1, 0)}
+	fresh := cacheObject{cfg: []byte(`{}`), ts: time.Unix(2, 0)}
+
+	if err := persistent.Set("acct", stale); err != nil {
+		t.Fatalf("Set persistent: %v", err)
+	}
+	mem.Set("acct", fresh)
+
+	got := l.Get("acct")
+	if got == nil || !got.ts.Equal(fresh.ts) {
+		t.Fatalf("expected layeredCache.Get to prefer the in-memory tier over the persistent one")
+	}
+}
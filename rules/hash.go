@@ -0,0 +1,174 @@
+package rules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Hash is a content hash of a Node or Tree, computed bottom-up so that two
+// subtrees with identical schema functions, edge values and children always
+// produce the same Hash regardless of where they sit in the overall tree.
+type Hash string
+
+// hashableFunc is implemented by SchemaFunction/ResultFunction implementations
+// that want their full spec (name + args) folded into the hash rather than
+// just their name. Functions that don't implement it still hash safely off
+// of Name() alone.
+type hashableFunc interface {
+	Spec() json.RawMessage
+}
+
+// named is implemented by SchemaFunction and (assumed) by ResultFunction
+// implementations that expose their registered name; funcSpec degrades to
+// an empty name rather than requiring it, since ResultFunction's full
+// interface shape isn't this package's to assume.
+type named interface {
+	Name() string
+}
+
+func funcSpec(fn any) json.RawMessage {
+	if sp, ok := fn.(hashableFunc); ok {
+		return sp.Spec()
+	}
+	name := ""
+	if nm, ok := fn.(named); ok {
+		name = nm.Name()
+	}
+	b, _ := json.Marshal(name)
+	return b
+}
+
+// Hash computes this node's content hash bottom-up: a leaf's hash covers
+// its schema function's spec plus its result functions' specs in config
+// order (order matters: result functions run in sequence and reordering
+// them can change behavior, so unlike children they are not sorted). An
+// internal node's hash additionally folds in every child's edge value and
+// hash, sorted by edge value so the result is independent of map iteration
+// order. A config change that swaps which result functions a leaf (or
+// dead-end node) has therefore still changes the node's hash. An edit to
+// only a function's args changes it only when that function implements
+// Spec (see hashableFunc); otherwise just its Name() is hashed. A Tree's
+// DefaultFunctions are not part of any node's hash.
+func (n *Node[T1, T2]) Hash() Hash {
+	if n == nil {
+		return ""
+	}
+
+	type childEntry struct {
+		Value string `json:"value"`
+		Hash  Hash   `json:"hash"`
+	}
+
+	entries := make([]childEntry, 0, len(n.Children))
+	for value, child := range n.Children {
+		entries = append(entries, childEntry{Value: value, Hash: child.Hash()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Value < entries[j].Value })
+
+	resultFuncs := make([]json.RawMessage, 0, len(n.ResultFunctions))
+	for _, rf := range n.ResultFunctions {
+		resultFuncs = append(resultFuncs, funcSpec(rf))
+	}
+
+	payload := struct {
+		SchemaFunc  json.RawMessage   `json:"schemaFunc,omitempty"`
+		ResultFuncs []json.RawMessage `json:"resultFuncs,omitempty"`
+		Children    []childEntry      `json:"children,omitempty"`
+	}{
+		ResultFuncs: resultFuncs,
+		Children:    entries,
+	}
+	if n.SchemaFunction != nil {
+		payload.SchemaFunc = funcSpec(n.SchemaFunction)
+	}
+
+	return hashJSON(payload)
+}
+
+// Hash computes the content hash of the tree's root node. Two trees built
+// from different config documents that happen to describe the same
+// structure hash identically.
+func (t *Tree[T1, T2]) Hash() Hash {
+	if t == nil {
+		return ""
+	}
+	return t.Root.Hash()
+}
+
+func hashJSON(v any) Hash {
+	// v is always a struct of strings/Hash/json.RawMessage with its children
+	// pre-sorted and its result functions in config order, so Marshal is
+	// both deterministic and infallible.
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(b)
+	return Hash(hex.EncodeToString(sum[:]))
+}
+
+// hashCacheEntry pairs a cached subtree with the last time it was looked up
+// (via Get or PutIfAbsent), so Prune can tell which entries are still in
+// use.
+type hashCacheEntry[T1 any, T2 any] struct {
+	node     *Node[T1, T2]
+	lastUsed time.Time
+}
+
+// HashCache memoizes compiled subtrees by content hash so that identical
+// subtrees appearing in multiple model groups, or unchanged across a config
+// refresh, are only ever compiled once.
+type HashCache[T1 any, T2 any] struct {
+	mu    sync.RWMutex
+	nodes map[Hash]*hashCacheEntry[T1, T2]
+}
+
+// NewHashCache returns an empty HashCache ready for use.
+func NewHashCache[T1 any, T2 any]() *HashCache[T1, T2] {
+	return &HashCache[T1, T2]{nodes: make(map[Hash]*hashCacheEntry[T1, T2])}
+}
+
+// Get returns the compiled subtree previously stored under h, if any.
+func (c *HashCache[T1, T2]) Get(h Hash) (*Node[T1, T2], bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.nodes[h]
+	if !ok {
+		return nil, false
+	}
+	e.lastUsed = time.Now()
+	return e.node, true
+}
+
+// PutIfAbsent stores n under h unless a subtree is already cached for that
+// hash, in which case the existing one wins so callers always graft the
+// same *Node for a given hash.
+func (c *HashCache[T1, T2]) PutIfAbsent(h Hash, n *Node[T1, T2]) *Node[T1, T2] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.nodes[h]; ok {
+		existing.lastUsed = time.Now()
+		return existing.node
+	}
+	c.nodes[h] = &hashCacheEntry[T1, T2]{node: n, lastUsed: time.Now()}
+	return n
+}
+
+// Prune discards any cached subtree that hasn't been looked up (via Get or
+// PutIfAbsent) in longer than maxAge, bounding the cache's size for a
+// long-running process that can otherwise accumulate one entry per distinct
+// subtree hash it has ever seen, for the life of the process.
+func (c *HashCache[T1, T2]) Prune(maxAge time.Duration) {
+	cutoff := time.Now().Add(-maxAge)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for h, e := range c.nodes {
+		if e.lastUsed.Before(cutoff) {
+			delete(c.nodes, h)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package rules
+
+import "testing"
+
+type fakeSchemaFunc struct {
+	name string
+	ret  string
+}
+
+func (f *fakeSchemaFunc) Call(payload *string) (string, error) { return f.ret, nil }
+func (f *fakeSchemaFunc) Name() string                         { return f.name }
+
+type fakeResultFunc struct {
+	name string
+}
+
+func (f *fakeResultFunc) Call(payload *string, result *string, meta ResultFunctionMeta) error {
+	return nil
+}
+func (f *fakeResultFunc) Name() string { return f.name }
+
+func TestNodeHash_ResultFunctionsAffectHash(t *testing.T) {
+	leafA := &Node[string, string]{
+		ResultFunctions: []ResultFunction[string, string]{&fakeResultFunc{name: "bidAdjustment"}},
+	}
+	leafB := &Node[string, string]{
+		ResultFunctions: []ResultFunction[string, string]{&fakeResultFunc{name: "analyticsKey"}},
+	}
+
+	if leafA.Hash() == leafB.Hash() {
+		t.Fatalf("expected leaves with different result functions to hash differently")
+	}
+}
+
+func TestNodeHash_IdenticalSubtreesMatch(t *testing.T) {
+	build := func() *Node[string, string] {
+		return &Node[string, string]{
+			SchemaFunction: &fakeSchemaFunc{name: "deviceCountry", ret: "US"},
+			Children: map[string]*Node[string, string]{
+				"US": {ResultFunctions: []ResultFunction[string, string]{&fakeResultFunc{name: "floor"}}},
+			},
+		}
+	}
+
+	a, b := build(), build()
+	if a.Hash() != b.Hash() {
+		t.Fatalf("expected identical subtrees built from identical specs to hash the same")
+	}
+}
+
+func TestNodeHash_ChildOrderDoesNotAffectHash(t *testing.T) {
+	a := &Node[string, string]{
+		Children: map[string]*Node[string, string]{
+			"US": {SchemaFunction: &fakeSchemaFunc{name: "a", ret: "1"}},
+			"FR": {SchemaFunction: &fakeSchemaFunc{name: "b", ret: "2"}},
+		},
+	}
+	b := &Node[string, string]{
+		Children: map[string]*Node[string, string]{
+			"FR": {SchemaFunction: &fakeSchemaFunc{name: "b", ret: "2"}},
+			"US": {SchemaFunction: &fakeSchemaFunc{name: "a", ret: "1"}},
+		},
+	}
+
+	if a.Hash() != b.Hash() {
+		t.Fatalf("expected map iteration order not to affect the hash")
+	}
+}
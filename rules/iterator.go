@@ -0,0 +1,159 @@
+package rules
+
+// Walker lazily exposes every step of a Tree's descent for a given payload,
+// so callers (tracing, debugging endpoints, or code that wants to
+// short-circuit once a partial decision is already actionable) can observe
+// the walk without duplicating Run's traversal logic.
+type Walker[T1 any, T2 any] interface {
+	// Next advances the walk by one schema function call, returning false
+	// once nothing more can be done: a leaf was reached, a dead end was
+	// hit (the schema function's result didn't match any child), or Call
+	// returned an error. Note that the step that lands on a dead end is
+	// still delivered on the Next call that causes it — Node() reports nil
+	// for that call to distinguish "dead end" from "leaf reached", where
+	// Node() still returns the leaf.
+	Next() bool
+	// Node returns the node the walk is currently positioned at, or nil if
+	// the walk just hit a dead end. Valid only after a call to Next that
+	// returned true.
+	Node() *Node[T1, T2]
+	// Step returns the schema function step that produced the current
+	// Next() result, i.e. the step that moved the walk from the parent
+	// towards Node() (or into the dead end). The zero value is returned
+	// for the root, which isn't reached via a step.
+	Step() SchemaFunctionStep
+	// Err returns the error, if any, that stopped the walk. It's only
+	// meaningful after Next has returned false.
+	Err() error
+	// Close releases the walker. It is always safe to call and is a no-op
+	// after the first call.
+	Close()
+}
+
+type treeWalker[T1 any, T2 any] struct {
+	payload *T1
+	curr    *Node[T1, T2]
+	step    SchemaFunctionStep
+	started bool
+	done    bool
+	err     error
+}
+
+// Iterator returns a Walker that descends t for payload one node at a time.
+// Run is implemented on top of this so both share one traversal.
+func (t *Tree[T1, T2]) Iterator(payload *T1) Walker[T1, T2] {
+	return &treeWalker[T1, T2]{payload: payload, curr: t.Root}
+}
+
+func (w *treeWalker[T1, T2]) Next() bool {
+	if w.done {
+		return false
+	}
+
+	if !w.started {
+		w.started = true
+		w.step = SchemaFunctionStep{}
+		if w.curr == nil {
+			w.done = true
+			return false
+		}
+		return true
+	}
+
+	if w.curr == nil {
+		// The previous Next() call already walked onto a dead end.
+		w.done = true
+		return false
+	}
+
+	if len(w.curr.Children) == 0 {
+		w.done = true
+		return false
+	}
+
+	res, err := w.curr.SchemaFunction.Call(w.payload)
+	if err != nil {
+		w.err = err
+		w.curr = nil
+		w.done = true
+		return false
+	}
+
+	w.step = SchemaFunctionStep{FuncName: w.curr.SchemaFunction.Name(), FuncResult: res}
+	w.curr = w.curr.Children[res] // nil here means this step was a dead end
+	return true
+}
+
+func (w *treeWalker[T1, T2]) Node() *Node[T1, T2] { return w.curr }
+
+func (w *treeWalker[T1, T2]) Step() SchemaFunctionStep { return w.step }
+
+func (w *treeWalker[T1, T2]) Err() error { return w.err }
+
+func (w *treeWalker[T1, T2]) Close() { w.done = true }
+
+// TeeIterator wraps Iterator, fanning every step out to steps in addition to
+// returning them through the normal Walker interface, so out-of-band
+// analytics can observe the walk without slowing down the caller driving it.
+// Sends are non-blocking: if no receiver is ready and steps has no free
+// buffer space, the step is dropped rather than stalling the walk.
+func (t *Tree[T1, T2]) TeeIterator(payload *T1, steps chan<- SchemaFunctionStep) Walker[T1, T2] {
+	return &teeWalker[T1, T2]{Walker: t.Iterator(payload), steps: steps}
+}
+
+type teeWalker[T1 any, T2 any] struct {
+	Walker[T1, T2]
+	steps chan<- SchemaFunctionStep
+}
+
+func (w *teeWalker[T1, T2]) Next() bool {
+	ok := w.Walker.Next()
+	if ok {
+		step := w.Walker.Step()
+		if step.FuncName != "" {
+			select {
+			case w.steps <- step:
+			default:
+			}
+		}
+	}
+	return ok
+}
+
+// Run attempts to walk down the tree from the root to a leaf node, driving
+// the same traversal as Iterator. Each node references a schema function to
+// execute that returns a result that is used to compare against the node
+// values on the level below it. If the result matches one of the node
+// values on the next level, we move to that node, otherwise we exit. If a
+// leaf node is reached, its result functions are executed on the provided
+// result payload.
+func (t *Tree[T1, T2]) Run(payload *T1, result *T2) error {
+	it := t.Iterator(payload)
+	defer it.Close()
+
+	resFuncMeta := ResultFunctionMeta{SchemaFunctionResults: make([]SchemaFunctionStep, 0)}
+
+	var last *Node[T1, T2]
+	for it.Next() {
+		last = it.Node()
+		if step := it.Step(); step.FuncName != "" {
+			resFuncMeta.SchemaFunctionResults = append(resFuncMeta.SchemaFunctionResults, step)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	resultFuncs := t.DefaultFunctions
+	if last != nil {
+		resultFuncs = last.ResultFunctions
+	}
+
+	for _, rf := range resultFuncs {
+		if err := rf.Call(payload, result, resFuncMeta); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package rules
+
+import (
+	"errors"
+	"testing"
+)
+
+type recordingResultFunc struct {
+	name   string
+	called *bool
+}
+
+func (f *recordingResultFunc) Call(payload *string, result *string, meta ResultFunctionMeta) error {
+	*f.called = true
+	*result = f.name
+	return nil
+}
+func (f *recordingResultFunc) Name() string { return f.name }
+
+type erroringSchemaFunc struct{ err error }
+
+func (f *erroringSchemaFunc) Call(payload *string) (string, error) { return "", f.err }
+func (f *erroringSchemaFunc) Name() string                         { return "erroring" }
+
+func TestRun_DeadEndFallsBackToDefaultFunctions(t *testing.T) {
+	var calledLeaf, calledDefault bool
+
+	tree := &Tree[string, string]{
+		Root: &Node[string, string]{
+			SchemaFunction: &fakeSchemaFunc{name: "deviceCountry", ret: "FR"}, // no "FR" child below
+			Children: map[string]*Node[string, string]{
+				"US": {ResultFunctions: []ResultFunction[string, string]{&recordingResultFunc{name: "us", called: &calledLeaf}}},
+			},
+		},
+		DefaultFunctions: []ResultFunction[string, string]{&recordingResultFunc{name: "default", called: &calledDefault}},
+	}
+
+	payload, result := "payload", ""
+	if err := tree.Run(&payload, &result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calledLeaf {
+		t.Fatalf("a dead end must not run the unrelated leaf's result functions")
+	}
+	if !calledDefault {
+		t.Fatalf("expected DefaultFunctions to run on a dead end")
+	}
+	if result != "default" {
+		t.Fatalf("got result %q, want %q", result, "default")
+	}
+}
+
+func TestRun_LeafRunsItsOwnResultFunctions(t *testing.T) {
+	var calledLeaf, calledDefault bool
+
+	tree := &Tree[string, string]{
+		Root: &Node[string, string]{
+			SchemaFunction: &fakeSchemaFunc{name: "deviceCountry", ret: "US"},
+			Children: map[string]*Node[string, string]{
+				"US": {ResultFunctions: []ResultFunction[string, string]{&recordingResultFunc{name: "us", called: &calledLeaf}}},
+			},
+		},
+		DefaultFunctions: []ResultFunction[string, string]{&recordingResultFunc{name: "default", called: &calledDefault}},
+	}
+
+	payload, result := "payload", ""
+	if err := tree.Run(&payload, &result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !calledLeaf || calledDefault {
+		t.Fatalf("expected the leaf's own result functions to run instead of DefaultFunctions")
+	}
+}
+
+func TestRun_PropagatesSchemaFunctionError(t *testing.T) {
+	wantErr := errors.New("boom")
+	tree := &Tree[string, string]{
+		Root: &Node[string, string]{
+			SchemaFunction: &erroringSchemaFunc{err: wantErr},
+			Children:       map[string]*Node[string, string]{"US": {}},
+		},
+	}
+
+	payload, result := "payload", ""
+	if err := tree.Run(&payload, &result); !errors.Is(err, wantErr) {
+		t.Fatalf("got error %v, want %v", err, wantErr)
+	}
+}
@@ -0,0 +1,132 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// SchemaFuncCtor builds a SchemaFunction from its raw JSON args. Implementations
+// register one of these per function name via Registry.RegisterSchema.
+type SchemaFuncCtor[T1 any] func(json.RawMessage) (SchemaFunction[T1], error)
+
+// ResultFuncCtor builds a ResultFunction from its raw JSON args. Implementations
+// register one of these per function name via Registry.RegisterResult.
+type ResultFuncCtor[T1 any, T2 any] func(json.RawMessage) (ResultFunction[T1, T2], error)
+
+// Registry is a lookup of schema/result function constructors by name, which
+// a tree builder can use in place of routing by name itself. It lets
+// bidders/adapters drop in new predicates (geo, device, floors, experiment
+// bucketing) without editing the core tree builder.
+type Registry[T1 any, T2 any] struct {
+	mu      sync.RWMutex
+	schemas map[string]SchemaFuncCtor[T1]
+	results map[string]ResultFuncCtor[T1, T2]
+}
+
+// NewRegistry returns an empty Registry ready for use.
+func NewRegistry[T1 any, T2 any]() *Registry[T1, T2] {
+	return &Registry[T1, T2]{
+		schemas: make(map[string]SchemaFuncCtor[T1]),
+		results: make(map[string]ResultFuncCtor[T1, T2]),
+	}
+}
+
+// RegistryError reports an unknown or duplicate function name in Names.
+// Every RegistryError this package returns carries exactly one name: each
+// Register/New call reports only the name it was given, so building a config
+// with several unknown names fails on the first one looked up.
+type RegistryError struct {
+	Reason string
+	Names  []string
+}
+
+func (e *RegistryError) Error() string {
+	return fmt.Sprintf("rules: %s: %v", e.Reason, e.Names)
+}
+
+// RegisterSchema registers a SchemaFunction constructor under name. name may
+// be versioned (e.g. "deviceCountry@v2") so config authors can pin a
+// function's behavior across upgrades; RegisterSchema does not parse or
+// validate the version suffix, it's just part of the lookup key.
+func (r *Registry[T1, T2]) RegisterSchema(name string, ctor SchemaFuncCtor[T1]) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.schemas[name]; exists {
+		return &RegistryError{Reason: "duplicate schema function", Names: []string{name}}
+	}
+	r.schemas[name] = ctor
+	return nil
+}
+
+// RegisterResult registers a ResultFunction constructor under name.
+func (r *Registry[T1, T2]) RegisterResult(name string, ctor ResultFuncCtor[T1, T2]) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.results[name]; exists {
+		return &RegistryError{Reason: "duplicate result function", Names: []string{name}}
+	}
+	r.results[name] = ctor
+	return nil
+}
+
+// MustRegisterSchema is RegisterSchema for package init blocks: third-party
+// packages call it from their own init() to self-register, and a collision
+// is a programming error worth panicking on at startup rather than surfacing
+// as a config-time error.
+func (r *Registry[T1, T2]) MustRegisterSchema(name string, ctor SchemaFuncCtor[T1]) {
+	if err := r.RegisterSchema(name, ctor); err != nil {
+		panic(err)
+	}
+}
+
+// MustRegisterResult is RegisterResult for package init blocks; see
+// MustRegisterSchema.
+func (r *Registry[T1, T2]) MustRegisterResult(name string, ctor ResultFuncCtor[T1, T2]) {
+	if err := r.RegisterResult(name, ctor); err != nil {
+		panic(err)
+	}
+}
+
+// NewSchemaFunction looks up and constructs the SchemaFunction registered
+// under name, returning a RegistryError listing name if it isn't registered.
+func (r *Registry[T1, T2]) NewSchemaFunction(name string, args json.RawMessage) (SchemaFunction[T1], error) {
+	r.mu.RLock()
+	ctor, ok := r.schemas[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, &RegistryError{Reason: "unknown schema function", Names: []string{name}}
+	}
+	return ctor(args)
+}
+
+// NewResultFunction looks up and constructs the ResultFunction registered
+// under name, returning a RegistryError listing name if it isn't registered.
+func (r *Registry[T1, T2]) NewResultFunction(name string, args json.RawMessage) (ResultFunction[T1, T2], error) {
+	r.mu.RLock()
+	ctor, ok := r.results[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, &RegistryError{Reason: "unknown result function", Names: []string{name}}
+	}
+	return ctor(args)
+}
+
+// SchemaFuncFactory adapts r into the legacy SchemaFuncFactory shape so
+// existing builders can switch to registry-backed lookup without changing
+// how they call their factory.
+func (r *Registry[T1, T2]) SchemaFuncFactory() SchemaFuncFactory[T1] {
+	return func(name string, args json.RawMessage) (SchemaFunction[T1], error) {
+		return r.NewSchemaFunction(name, args)
+	}
+}
+
+// ResultFuncFactory adapts r into the legacy ResultFuncFactory shape; see
+// SchemaFuncFactory.
+func (r *Registry[T1, T2]) ResultFuncFactory() ResultFuncFactory[T1, T2] {
+	return func(name string, args json.RawMessage) (ResultFunction[T1, T2], error) {
+		return r.NewResultFunction(name, args)
+	}
+}
@@ -0,0 +1,64 @@
+package rules
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRegistry_RegisterAndLookupSchemaFunction(t *testing.T) {
+	reg := NewRegistry[string, string]()
+
+	err := reg.RegisterSchema("deviceCountry", func(args json.RawMessage) (SchemaFunction[string], error) {
+		return &fakeSchemaFunc{name: "deviceCountry", ret: "US"}, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error registering schema function: %v", err)
+	}
+
+	fn, err := reg.NewSchemaFunction("deviceCountry", nil)
+	if err != nil {
+		t.Fatalf("unexpected error looking up schema function: %v", err)
+	}
+	if fn.Name() != "deviceCountry" {
+		t.Fatalf("got name %q, want %q", fn.Name(), "deviceCountry")
+	}
+}
+
+func TestRegistry_DuplicateSchemaRegistrationIsRejected(t *testing.T) {
+	reg := NewRegistry[string, string]()
+	ctor := func(args json.RawMessage) (SchemaFunction[string], error) {
+		return &fakeSchemaFunc{}, nil
+	}
+
+	if err := reg.RegisterSchema("deviceCountry", ctor); err != nil {
+		t.Fatalf("unexpected error on first registration: %v", err)
+	}
+	if err := reg.RegisterSchema("deviceCountry", ctor); err == nil {
+		t.Fatalf("expected duplicate schema registration to be rejected")
+	}
+}
+
+func TestRegistry_UnknownFunctionNamesError(t *testing.T) {
+	reg := NewRegistry[string, string]()
+
+	if _, err := reg.NewSchemaFunction("nope", nil); err == nil {
+		t.Fatalf("expected unknown schema function lookup to error")
+	}
+	if _, err := reg.NewResultFunction("nope", nil); err == nil {
+		t.Fatalf("expected unknown result function lookup to error")
+	}
+}
+
+func TestRegistry_VersionedNamesAreDistinctKeys(t *testing.T) {
+	reg := NewRegistry[string, string]()
+	ctor := func(args json.RawMessage) (SchemaFunction[string], error) {
+		return &fakeSchemaFunc{}, nil
+	}
+
+	if err := reg.RegisterSchema("deviceCountry@v1", ctor); err != nil {
+		t.Fatalf("unexpected error registering v1: %v", err)
+	}
+	if err := reg.RegisterSchema("deviceCountry@v2", ctor); err != nil {
+		t.Fatalf("expected a distinct version suffix to register independently, got: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package rules
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// RunAll evaluates every tree in groups against payload concurrently,
+// bounded by a worker pool of size concurrency, and writes each group's
+// result into results in the same order groups was given — regardless of
+// which goroutine finishes first. This is for stages whose ruleset has
+// multiple model groups that must all run (weighted A/B splits, shadow
+// groups for analytics). The returned errors are likewise in groups order.
+// Each group's result functions are called on the goroutine that evaluates
+// it, so calls into result functions of different groups can interleave in
+// any order.
+//
+// Each group gets its own ResultFunctionMeta, so one group's schema
+// function trace can never leak into another's. If concurrency is
+// exhausted when a group is dispatched (every worker slot taken), RunAll
+// runs that group inline on the calling goroutine rather than growing the
+// pool, to bound tail latency; later groups try the pool again.
+func RunAll[T1 any, T2 any](groups []*Tree[T1, T2], payload *T1, results []*T2, concurrency int) []error {
+	n := len(groups)
+	errs := make([]error, n)
+	if n == 0 {
+		return errs
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	out := &resultHeap{}
+	heap.Init(out)
+	var mu sync.Mutex
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	run := func(i int) {
+		defer wg.Done()
+		err := groups[i].Run(payload, results[i])
+
+		mu.Lock()
+		heap.Push(out, indexedErr{index: i, err: err})
+		mu.Unlock()
+	}
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+
+		select {
+		case sem <- struct{}{}:
+			go func(i int) {
+				defer func() { <-sem }()
+				run(i)
+			}(i)
+		default:
+			// Pool saturated: run this group inline to bound tail
+			// latency instead of growing the pool unbounded.
+			run(i)
+		}
+	}
+
+	wg.Wait()
+
+	for out.Len() > 0 {
+		ie := heap.Pop(out).(indexedErr)
+		errs[ie.index] = ie.err
+	}
+
+	return errs
+}
+
+// indexedErr pairs a model group's index (its position in the config-
+// declared order) with the error from running it, so the min-heap can pop
+// results back out in that order regardless of completion order.
+type indexedErr struct {
+	index int
+	err   error
+}
+
+// resultHeap is a container/heap.Interface keyed on indexedErr.index, so
+// results pushed in completion order pop back out in groups order.
+type resultHeap []indexedErr
+
+func (h resultHeap) Len() int           { return len(h) }
+func (h resultHeap) Less(i, j int) bool { return h[i].index < h[j].index }
+func (h resultHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x any)        { *h = append(*h, x.(indexedErr)) }
+func (h *resultHeap) Pop() any {
+	old := *h
+	n := len(old)
+	v := old[n-1]
+	*h = old[:n-1]
+	return v
+}
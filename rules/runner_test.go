@@ -0,0 +1,39 @@
+package rules
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestRunAll_PreservesConfigDeclaredOrder(t *testing.T) {
+	const n = 8
+
+	trees := make([]*Tree[string, string], n)
+	results := make([]*string, n)
+	for i := 0; i < n; i++ {
+		called := new(bool)
+		trees[i] = &Tree[string, string]{
+			Root: &Node[string, string]{
+				ResultFunctions: []ResultFunction[string, string]{
+					&recordingResultFunc{name: strconv.Itoa(i), called: called},
+				},
+			},
+		}
+		results[i] = new(string)
+	}
+
+	payload := "payload"
+	errs := RunAll(trees, &payload, results, 3)
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("group %d: unexpected error: %v", i, err)
+		}
+	}
+	for i, r := range results {
+		want := strconv.Itoa(i)
+		if *r != want {
+			t.Fatalf("results[%d] = %q, want %q (results must come back in config order regardless of goroutine scheduling)", i, *r, want)
+		}
+	}
+}
@@ -17,44 +17,7 @@ type Tree[T1 any, T2 any] struct {
 	DefaultFunctions []ResultFunction[T1, T2]
 }
 
-// Run attempts to walk down the tree from the root to a leaf node. Each node references a schema function
-// to execute that returns a result that is used to compare against the node values on the level below it.
-// If the result matches one of the node values on the next level, we move to that node, otherwise we exit.
-// If a leaf node is reached, it's result functions are executed on the provided result payload.
-func (t *Tree[T1, T2]) Run(payload *T1, result *T2) error {
-	currNode := t.Root
-
-	resFuncMeta := ResultFunctionMeta{SchemaFunctionResults: make([]SchemaFunctionStep, 0)}
-
-	for len(currNode.Children) > 0 {
-		res, err := currNode.SchemaFunction.Call(payload)
-		if err != nil {
-			return err
-		}
-
-		step := SchemaFunctionStep{FuncName: currNode.SchemaFunction.Name(), FuncResult: res}
-		resFuncMeta.SchemaFunctionResults = append(resFuncMeta.SchemaFunctionResults, step)
-
-		currNode = currNode.Children[res]
-		if currNode == nil {
-			break
-		}
-	}
-
-	resultFuncs := t.DefaultFunctions
-	if currNode != nil {
-		resultFuncs = currNode.ResultFunctions
-	}
-
-	for _, rf := range resultFuncs {
-		err := rf.Call(payload, result, resFuncMeta)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
+// Run is implemented in iterator.go, on top of Tree.Iterator.
 
 // Valid ensures that the tree is well-formed meaning that every leaf is at the same level
 func (t *Tree[T1, T2]) validate() error {
@@ -90,9 +53,15 @@ func NewTree[T1 any, T2 any](builder treeBuilder[T1, T2]) (*Tree[T1, T2], error)
 // SchemaFuncFactory is a function that takes a function name and arguments in JSON format
 // and returns a SchemaFunction and an error.
 // It is used to create schema functions for the tree nodes based on the provided configuration.
+//
+// Builders that want pluggable, third-party-extensible lookup instead of
+// routing by name themselves should prefer a Registry and its
+// SchemaFuncFactory method, which adapts a Registry into this same shape.
 type SchemaFuncFactory[T any] func(string, json.RawMessage) (SchemaFunction[T], error)
 
 // ResultFuncFactory is a function that takes a function name and arguments in JSON format
 // and returns a ResultFunction and an error.
 // It is used to create result functions for the tree nodes based on the provided configuration.
+//
+// See SchemaFuncFactory for the Registry-backed alternative.
 type ResultFuncFactory[T1 any, T2 any] func(string, json.RawMessage) (ResultFunction[T1, T2], error)